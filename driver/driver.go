@@ -0,0 +1,151 @@
+// Package driver abstracts the SQL dialect differences voyager needs in
+// order to track migration history and coordinate a single migrator across
+// concurrent processes. A Driver knows how to take out an advisory-style
+// lock, check for the existence of a table, and read/write rows in the
+// migrations history table for one specific database engine.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// HistoryRecord is a single row of the migrations history table.
+type HistoryRecord struct {
+	Version   int
+	Direction string
+	Status    string
+	Dirty     bool
+	// ParentVersion is the version that was current immediately before this
+	// one was attempted, forming a linear chain through history. Zero means
+	// this was the first migration ever attempted.
+	ParentVersion int
+}
+
+type Driver interface {
+	// AcquireLock takes out a database-wide lock identified by lockID,
+	// blocking only for the duration of the call. Callers retry.
+	AcquireLock(ctx context.Context, db *sql.DB, lockID int) (bool, error)
+	ReleaseLock(ctx context.Context, db *sql.DB, lockID int) (bool, error)
+
+	// QualifiedTableName returns table, qualified by schema when schema is
+	// non-empty, with both identifiers quoted per this dialect's rules.
+	// The result is meant to be interpolated directly into SQL that cannot
+	// otherwise parameterize an identifier (CREATE TABLE, INSERT INTO,
+	// SELECT ... FROM).
+	QualifiedTableName(schema, table string) string
+
+	// TableExists reports whether tableName exists within schema. An empty
+	// schema means the dialect's default schema for the current connection
+	// (e.g. Postgres's search_path, MySQL's DATABASE()), so that two
+	// migrators configured with distinct schemas only ever see their own
+	// history table, not each other's.
+	TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error)
+	EnsureHistoryTable(ctx context.Context, db *sql.DB, tableName string) error
+
+	InsertHistory(ctx context.Context, db *sql.DB, tableName string, record HistoryRecord) error
+	// UpdateStatus transitions the in_progress row for version to status,
+	// setting its dirty flag. Used to resolve a migration attempt recorded
+	// by InsertHistory once it succeeds or fails.
+	UpdateStatus(ctx context.Context, db *sql.DB, tableName string, version int, status string, dirty bool) error
+	// HasVersion reports whether any row in the history table has exactly
+	// the given version.
+	HasVersion(ctx context.Context, db *sql.DB, tableName string, version int) (bool, error)
+	// HasInProgress reports whether any row in the history table is
+	// currently in_progress, i.e. a prior migration attempt crashed before
+	// it could transition to complete or failed.
+	HasInProgress(ctx context.Context, db *sql.DB, tableName string) (bool, error)
+	// SelectCurrent returns the most recently completed history row, and
+	// false if the table has no completed rows yet.
+	SelectCurrent(ctx context.Context, db *sql.DB, tableName string) (HistoryRecord, bool, error)
+	// SelectBefore returns the most recently completed history row with a
+	// version strictly less than version, and false if there is none.
+	SelectBefore(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error)
+	// SelectByVersion returns the completed history row recorded for
+	// version, and false if no completed row has that version. Used to
+	// walk the chain of ParentVersion pointers from SelectCurrent back to
+	// the root.
+	SelectByVersion(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error)
+	// AllVersions returns every distinct version recorded in the history
+	// table, in ascending order.
+	AllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error)
+	// EnsureSingleActiveIndex creates whatever constraint this dialect
+	// supports to enforce that at most one history row is ever in_progress
+	// at a time.
+	EnsureSingleActiveIndex(ctx context.Context, db *sql.DB, tableName string) error
+}
+
+// quoteDoubleQuoted builds a schema-qualified identifier using ANSI-style
+// double-quoting, as used by Postgres and SQLite.
+func quoteDoubleQuoted(schema, table string) string {
+	quote := func(ident string) string {
+		return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+	}
+	if schema == "" {
+		return quote(table)
+	}
+	return quote(schema) + "." + quote(table)
+}
+
+// quoteBacktickQuoted builds a schema-qualified identifier using MySQL's
+// backtick quoting.
+func quoteBacktickQuoted(schema, table string) string {
+	quote := func(ident string) string {
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	}
+	if schema == "" {
+		return quote(table)
+	}
+	return quote(schema) + "." + quote(table)
+}
+
+// singleActiveIndexName derives a stable, identifier-safe index name from a
+// (possibly schema-qualified, possibly quoted) table name.
+func singleActiveIndexName(tableName string) string {
+	var b strings.Builder
+	for _, r := range tableName {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return "voyager_single_active_" + b.String()
+}
+
+// queryAllVersions implements AllVersions for dialects whose SELECT DISTINCT
+// syntax needs no placeholders, which covers all three built-in drivers.
+func queryAllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT DISTINCT version FROM %s ORDER BY version", tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// Detect picks a Driver based on the concrete type of db's registered
+// driver. It defaults to Postgres, voyager's original and most common
+// target, when the driver type is unrecognised.
+func Detect(db *sql.DB) Driver {
+	switch fmt.Sprintf("%T", db.Driver()) {
+	case "*mysql.MySQLDriver":
+		return MySQL{}
+	case "*sqlite3.SQLiteDriver":
+		return SQLite{}
+	default:
+		return Postgres{}
+	}
+}
@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+// queryStubConn is a database/sql/driver.Conn that records every query it's
+// asked to run and always reports a single boolean row, used to check
+// which SQL a dialect issues without a real database.
+type queryStubConn struct {
+	queries []string
+	args    [][]sqldriver.NamedValue
+	result  bool
+}
+
+func (c *queryStubConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return nil, errors.New("queryStubConn: Prepare not supported")
+}
+func (c *queryStubConn) Close() error { return nil }
+func (c *queryStubConn) Begin() (sqldriver.Tx, error) {
+	return nil, errors.New("queryStubConn: Begin not supported")
+}
+
+func (c *queryStubConn) QueryContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	c.queries = append(c.queries, query)
+	c.args = append(c.args, args)
+	return &boolRow{value: c.result}, nil
+}
+
+// boolRow is a one-row, one-column driver.Rows yielding a single bool,
+// enough to satisfy a `SELECT EXISTS (...)` query.
+type boolRow struct {
+	value bool
+	done  bool
+}
+
+func (r *boolRow) Columns() []string { return []string{"exists"} }
+func (r *boolRow) Close() error      { return nil }
+func (r *boolRow) Next(dest []sqldriver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+type queryStubDriver struct{ conn *queryStubConn }
+
+func (d *queryStubDriver) Open(name string) (sqldriver.Conn, error) { return d.conn, nil }
+
+var queryStubSeq int64
+
+func openQueryStubDB(t *testing.T, result bool) (*sql.DB, *queryStubConn) {
+	t.Helper()
+	conn := &queryStubConn{result: result}
+	name := fmt.Sprintf("voyager-querystub-%d", atomic.AddInt64(&queryStubSeq, 1))
+	sql.Register(name, &queryStubDriver{conn: conn})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, conn
+}
+
+func TestPostgres_TableExists_FiltersBySchemaWhenGiven(t *testing.T) {
+	db, conn := openQueryStubDB(t, true)
+
+	exists, err := (Postgres{}).TableExists(context.Background(), db, "tenant_a", "migrations_history")
+	if err != nil {
+		t.Fatalf("TableExists: %v", err)
+	}
+	if !exists {
+		t.Fatal("TableExists = false, want true")
+	}
+	if len(conn.queries) != 1 {
+		t.Fatalf("expected exactly one query, got %d", len(conn.queries))
+	}
+	if got := conn.queries[0]; !contains(got, "table_schema") {
+		t.Fatalf("query %q does not filter by table_schema", got)
+	}
+	if len(conn.args) != 1 || len(conn.args[0]) != 2 {
+		t.Fatalf("expected schema and table to both be bound as query args, got %v", conn.args)
+	}
+}
+
+func TestPostgres_TableExists_DefaultsToCurrentSchemaWhenEmpty(t *testing.T) {
+	db, conn := openQueryStubDB(t, false)
+
+	exists, err := (Postgres{}).TableExists(context.Background(), db, "", "migrations_history")
+	if err != nil {
+		t.Fatalf("TableExists: %v", err)
+	}
+	if exists {
+		t.Fatal("TableExists = true, want false")
+	}
+	if got := conn.queries[0]; !contains(got, "current_schema()") {
+		t.Fatalf("query %q does not scope to current_schema()", got)
+	}
+}
+
+func TestMySQL_TableExists_FiltersBySchemaWhenGiven(t *testing.T) {
+	db, conn := openQueryStubDB(t, true)
+
+	if _, err := (MySQL{}).TableExists(context.Background(), db, "tenant_a", "migrations_history"); err != nil {
+		t.Fatalf("TableExists: %v", err)
+	}
+	if got := conn.queries[0]; !contains(got, "table_schema") {
+		t.Fatalf("query %q does not filter by table_schema", got)
+	}
+}
+
+func contains(haystack, needle string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if haystack[i:i+len(needle)] == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+// historyStubConn is a database/sql/driver.Conn recording every ExecContext
+// query it's asked to run, and answering QueryContext with a fixed set of
+// PRAGMA table_info columns, used to drive EnsureHistoryTable's
+// Exec-then-maybe-Query-then-maybe-Exec sequence without a real database.
+type historyStubConn struct {
+	execQueries []string
+	columns     []string // column names reported by a PRAGMA table_info query
+}
+
+func (c *historyStubConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return nil, errors.New("historyStubConn: Prepare not supported")
+}
+func (c *historyStubConn) Close() error { return nil }
+func (c *historyStubConn) Begin() (sqldriver.Tx, error) {
+	return nil, errors.New("historyStubConn: Begin not supported")
+}
+
+func (c *historyStubConn) ExecContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	c.execQueries = append(c.execQueries, query)
+	return sqldriver.ResultNoRows, nil
+}
+
+func (c *historyStubConn) QueryContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Rows, error) {
+	return &columnNameRows{names: c.columns}, nil
+}
+
+// columnNameRows simulates PRAGMA table_info(tbl), which yields one row per
+// column with the shape (cid, name, type, notnull, dflt_value, pk).
+type columnNameRows struct {
+	names []string
+	idx   int
+}
+
+func (r *columnNameRows) Columns() []string {
+	return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}
+}
+func (r *columnNameRows) Close() error { return nil }
+func (r *columnNameRows) Next(dest []sqldriver.Value) error {
+	if r.idx >= len(r.names) {
+		return io.EOF
+	}
+	dest[0] = int64(r.idx)
+	dest[1] = r.names[r.idx]
+	dest[2] = "text"
+	dest[3] = int64(0)
+	dest[4] = nil
+	dest[5] = int64(0)
+	r.idx++
+	return nil
+}
+
+type historyStubDriver struct{ conn *historyStubConn }
+
+func (d *historyStubDriver) Open(name string) (sqldriver.Conn, error) { return d.conn, nil }
+
+var historyStubSeq int64
+
+func openHistoryStubDB(t *testing.T, columns ...string) (*sql.DB, *historyStubConn) {
+	t.Helper()
+	conn := &historyStubConn{columns: columns}
+	name := fmt.Sprintf("voyager-historystub-%d", atomic.AddInt64(&historyStubSeq, 1))
+	sql.Register(name, &historyStubDriver{conn: conn})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, conn
+}
+
+func TestPostgres_EnsureHistoryTable_AddsParentVersionColumn(t *testing.T) {
+	db, conn := openHistoryStubDB(t)
+
+	if err := (Postgres{}).EnsureHistoryTable(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("EnsureHistoryTable: %v", err)
+	}
+
+	if len(conn.execQueries) != 2 {
+		t.Fatalf("expected CREATE TABLE and ALTER TABLE to both run, got %d statements: %v", len(conn.execQueries), conn.execQueries)
+	}
+	if !contains(conn.execQueries[1], "ADD COLUMN IF NOT EXISTS parent_version") {
+		t.Fatalf("second statement %q does not add parent_version", conn.execQueries[1])
+	}
+}
+
+func TestMySQL_EnsureHistoryTable_AddsParentVersionColumn(t *testing.T) {
+	db, conn := openHistoryStubDB(t)
+
+	if err := (MySQL{}).EnsureHistoryTable(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("EnsureHistoryTable: %v", err)
+	}
+
+	if len(conn.execQueries) != 2 {
+		t.Fatalf("expected CREATE TABLE and ALTER TABLE to both run, got %d statements: %v", len(conn.execQueries), conn.execQueries)
+	}
+	if !contains(conn.execQueries[1], "ADD COLUMN IF NOT EXISTS parent_version") {
+		t.Fatalf("second statement %q does not add parent_version", conn.execQueries[1])
+	}
+}
+
+func TestSQLite_EnsureHistoryTable_AddsColumnWhenMissing(t *testing.T) {
+	db, conn := openHistoryStubDB(t, "version", "tstamp", "direction", "status", "dirty")
+
+	if err := (SQLite{}).EnsureHistoryTable(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("EnsureHistoryTable: %v", err)
+	}
+
+	if len(conn.execQueries) != 2 {
+		t.Fatalf("expected CREATE TABLE and ALTER TABLE to both run, got %d statements: %v", len(conn.execQueries), conn.execQueries)
+	}
+	if !contains(conn.execQueries[1], "ADD COLUMN parent_version") {
+		t.Fatalf("second statement %q does not add parent_version", conn.execQueries[1])
+	}
+}
+
+func TestSQLite_EnsureHistoryTable_SkipsAlterWhenColumnPresent(t *testing.T) {
+	db, conn := openHistoryStubDB(t, "version", "tstamp", "direction", "status", "dirty", "parent_version")
+
+	if err := (SQLite{}).EnsureHistoryTable(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("EnsureHistoryTable: %v", err)
+	}
+
+	if len(conn.execQueries) != 1 {
+		t.Fatalf("expected only CREATE TABLE to run since parent_version already exists, got %d statements: %v", len(conn.execQueries), conn.execQueries)
+	}
+}
@@ -0,0 +1,150 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MySQL uses the named-lock functions GET_LOCK/RELEASE_LOCK in place of
+// Postgres's advisory locks, and ? placeholders throughout.
+type MySQL struct{}
+
+func lockName(lockID int) string {
+	return "voyager_" + strconv.Itoa(lockID)
+}
+
+func (MySQL) QualifiedTableName(schema, table string) string {
+	return quoteBacktickQuoted(schema, table)
+}
+
+func (MySQL) AcquireLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	var acquired int
+	err := db.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName(lockID)).Scan(&acquired)
+	return acquired == 1, err
+}
+
+func (MySQL) ReleaseLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	var released int
+	err := db.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lockName(lockID)).Scan(&released)
+	return released == 1, err
+}
+
+func (MySQL) TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error) {
+	var exists bool
+	if schema == "" {
+		err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name=?)", tableName).Scan(&exists)
+		return exists, err
+	}
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema=? AND table_name=?)", schema, tableName).Scan(&exists)
+	return exists, err
+}
+
+// EnsureHistoryTable creates tableName if it doesn't exist yet, and adds
+// parent_version via ALTER TABLE if it does -- every pre-existing voyager
+// deployment already has this table without that column, and CREATE TABLE
+// IF NOT EXISTS is a no-op against it. Requires MySQL 8.0.29 or newer, same
+// as EnsureSingleActiveIndex's use of ADD COLUMN IF NOT EXISTS below.
+func (MySQL) EnsureHistoryTable(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint, tstamp timestamp, direction varchar(8), status varchar(16), dirty boolean, parent_version bigint)", tableName))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN IF NOT EXISTS parent_version bigint", tableName))
+	return err
+}
+
+// EnsureSingleActiveIndex works around MySQL having no partial/filtered
+// unique index: a generated column collapses every non-in_progress row to
+// NULL, and InnoDB unique indexes permit any number of NULLs, leaving only
+// "in_progress" rows subject to the uniqueness check.
+//
+// ADD COLUMN IF NOT EXISTS requires MySQL 8.0.29 or newer. MySQL also has
+// no CREATE INDEX IF NOT EXISTS, so this is made idempotent by ignoring the
+// "duplicate key name" error a second CREATE UNIQUE INDEX returns, rather
+// than querying information_schema.statistics up front.
+func (MySQL) EnsureSingleActiveIndex(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN IF NOT EXISTS single_active_marker INT GENERATED ALWAYS AS (CASE WHEN status = 'in_progress' THEN 1 ELSE NULL END) STORED",
+		tableName))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE UNIQUE INDEX %s ON %s (single_active_marker)", singleActiveIndexName(tableName), tableName))
+	if err != nil && strings.Contains(err.Error(), "Duplicate key name") {
+		return nil
+	}
+	return err
+}
+
+func (MySQL) InsertHistory(ctx context.Context, db *sql.DB, tableName string, record HistoryRecord) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, tstamp, direction, status, dirty, parent_version) VALUES (?, NOW(), ?, ?, ?, ?)", tableName),
+		record.Version, record.Direction, record.Status, record.Dirty, record.ParentVersion)
+	return err
+}
+
+func (MySQL) UpdateStatus(ctx context.Context, db *sql.DB, tableName string, version int, status string, dirty bool) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET status=?, dirty=? WHERE version=? AND status='in_progress'", tableName),
+		status, dirty, version)
+	return err
+}
+
+func (MySQL) AllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error) {
+	return queryAllVersions(ctx, db, tableName)
+}
+
+func (MySQL) HasVersion(ctx context.Context, db *sql.DB, tableName string, version int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE version=?)", tableName), version).Scan(&exists)
+	return exists, err
+}
+
+func (MySQL) HasInProgress(ctx context.Context, db *sql.DB, tableName string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE status='in_progress')", tableName)).Scan(&exists)
+	return exists, err
+}
+
+func (MySQL) SelectCurrent(ctx context.Context, db *sql.DB, tableName string) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') ORDER BY tstamp DESC LIMIT 1", tableName)).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (MySQL) SelectBefore(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction FROM %s WHERE status IN ('passed', 'complete') AND version < ? ORDER BY tstamp DESC LIMIT 1", tableName), version).
+		Scan(&r.Version, &r.Direction)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (MySQL) SelectByVersion(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') AND version = ?", tableName), version).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
@@ -0,0 +1,78 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// execStubConn is a minimal database/sql/driver.Conn whose ExecContext
+// outcomes are scripted per call, used to drive dialect Exec-only code
+// paths without a real database.
+type execStubConn struct {
+	errs []error // popped one per ExecContext call; nil once exhausted
+}
+
+func (c *execStubConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return nil, errors.New("execStubConn: Prepare not supported")
+}
+func (c *execStubConn) Close() error { return nil }
+func (c *execStubConn) Begin() (sqldriver.Tx, error) {
+	return nil, errors.New("execStubConn: Begin not supported")
+}
+
+func (c *execStubConn) ExecContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	if len(c.errs) == 0 {
+		return sqldriver.ResultNoRows, nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return sqldriver.ResultNoRows, err
+}
+
+type execStubDriver struct{ conn *execStubConn }
+
+func (d *execStubDriver) Open(name string) (sqldriver.Conn, error) { return d.conn, nil }
+
+var execStubSeq int64
+
+func openExecStubDB(t *testing.T, errs ...error) *sql.DB {
+	t.Helper()
+	name := fmt.Sprintf("voyager-mysql-execstub-%d", atomic.AddInt64(&execStubSeq, 1))
+	sql.Register(name, &execStubDriver{conn: &execStubConn{errs: errs}})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMySQL_EnsureSingleActiveIndex_IdempotentOnRepeatedCalls(t *testing.T) {
+	// First invocation: ADD COLUMN and CREATE INDEX both succeed, as on a
+	// fresh database. Second invocation (simulating the next Migrate/Up
+	// call): ADD COLUMN IF NOT EXISTS is itself idempotent so it reports
+	// no error, but CREATE UNIQUE INDEX fails with MySQL's
+	// duplicate-key-name error because the index is already there.
+	dupErr := errors.New("Error 1061: Duplicate key name 'voyager_single_active_migrations_history'")
+	db := openExecStubDB(t, nil, nil, nil, dupErr)
+
+	if err := (MySQL{}).EnsureSingleActiveIndex(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("first EnsureSingleActiveIndex: %v", err)
+	}
+	if err := (MySQL{}).EnsureSingleActiveIndex(context.Background(), db, "migrations_history"); err != nil {
+		t.Fatalf("second EnsureSingleActiveIndex should be a no-op, got error: %v", err)
+	}
+}
+
+func TestMySQL_EnsureSingleActiveIndex_OtherErrorsStillSurface(t *testing.T) {
+	db := openExecStubDB(t, nil, errors.New("Error 1046: No database selected"))
+
+	if err := (MySQL{}).EnsureSingleActiveIndex(context.Background(), db, "migrations_history"); err == nil {
+		t.Fatal("expected a non-duplicate-key error to be returned, got nil")
+	}
+}
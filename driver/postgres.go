@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Postgres is voyager's original Driver, built on pg_try_advisory_lock and
+// information_schema.
+type Postgres struct{}
+
+func (Postgres) QualifiedTableName(schema, table string) string {
+	return quoteDoubleQuoted(schema, table)
+}
+
+func (Postgres) AcquireLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	var acquired bool
+	err := db.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, lockID).Scan(&acquired)
+	return acquired, err
+}
+
+func (Postgres) ReleaseLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	var released bool
+	err := db.QueryRowContext(ctx, `SELECT pg_advisory_unlock($1)`, lockID).Scan(&released)
+	return released, err
+}
+
+func (Postgres) TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error) {
+	var exists bool
+	if schema == "" {
+		err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name=$1)", tableName).Scan(&exists)
+		return exists, err
+	}
+	err := db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema=$1 AND table_name=$2)", schema, tableName).Scan(&exists)
+	return exists, err
+}
+
+// EnsureHistoryTable creates tableName if it doesn't exist yet, and adds
+// parent_version via ALTER TABLE if it does -- every pre-existing voyager
+// deployment already has this table without that column, and CREATE TABLE
+// IF NOT EXISTS is a no-op against it.
+func (Postgres) EnsureHistoryTable(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version bigint, tstamp timestamp with time zone, direction varchar, status varchar, dirty boolean, parent_version bigint)", tableName))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		"ALTER TABLE %s ADD COLUMN IF NOT EXISTS parent_version bigint", tableName))
+	return err
+}
+
+// EnsureSingleActiveIndex relies on a partial unique index, which Postgres
+// supports natively: only rows matching the predicate are indexed, so at
+// most one status='in_progress' row can ever exist.
+func (Postgres) EnsureSingleActiveIndex(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (status) WHERE status = 'in_progress'",
+		singleActiveIndexName(tableName), tableName))
+	return err
+}
+
+func (Postgres) InsertHistory(ctx context.Context, db *sql.DB, tableName string, record HistoryRecord) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, tstamp, direction, status, dirty, parent_version) VALUES ($1, current_timestamp, $2, $3, $4, $5)", tableName),
+		record.Version, record.Direction, record.Status, record.Dirty, record.ParentVersion)
+	return err
+}
+
+func (Postgres) UpdateStatus(ctx context.Context, db *sql.DB, tableName string, version int, status string, dirty bool) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET status=$1, dirty=$2 WHERE version=$3 AND status='in_progress'", tableName),
+		status, dirty, version)
+	return err
+}
+
+func (Postgres) AllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error) {
+	return queryAllVersions(ctx, db, tableName)
+}
+
+func (Postgres) HasVersion(ctx context.Context, db *sql.DB, tableName string, version int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE version=$1)", tableName), version).Scan(&exists)
+	return exists, err
+}
+
+func (Postgres) HasInProgress(ctx context.Context, db *sql.DB, tableName string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE status='in_progress')", tableName)).Scan(&exists)
+	return exists, err
+}
+
+func (Postgres) SelectCurrent(ctx context.Context, db *sql.DB, tableName string) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') ORDER BY tstamp DESC LIMIT 1", tableName)).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (Postgres) SelectBefore(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction FROM %s WHERE status IN ('passed', 'complete') AND version < $1 ORDER BY tstamp DESC LIMIT 1", tableName), version).
+		Scan(&r.Version, &r.Direction)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (Postgres) SelectByVersion(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') AND version = $1", tableName), version).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
@@ -0,0 +1,179 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SQLite has no advisory-lock primitive, so locking falls back to an
+// exclusively-created file in the OS temp directory named after the lock
+// ID. This is sufficient to coordinate multiple voyager processes on one
+// machine, which is the only topology SQLite supports anyway.
+type SQLite struct{}
+
+func lockFilePath(lockID int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("voyager-%d.lock", lockID))
+}
+
+func (SQLite) QualifiedTableName(schema, table string) string {
+	return quoteDoubleQuoted(schema, table)
+}
+
+func (SQLite) AcquireLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	f, err := os.OpenFile(lockFilePath(lockID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, f.Close()
+}
+
+func (SQLite) ReleaseLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	err := os.Remove(lockFilePath(lockID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// TableExists looks in the given attached database's sqlite_master, or the
+// main database's when schema is empty. SQLite has no information_schema
+// equivalent that spans schemas the way Postgres/MySQL do, so two
+// migrators only stay isolated here if they're given distinct attached
+// database names as their schema.
+func (SQLite) TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error) {
+	master := "sqlite_master"
+	if schema != "" {
+		master = fmt.Sprintf(`"%s".sqlite_master`, schema)
+	}
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE type='table' AND name=?)", master), tableName).Scan(&exists)
+	return exists, err
+}
+
+// EnsureHistoryTable creates tableName if it doesn't exist yet, and adds
+// parent_version if it doesn't -- every pre-existing voyager deployment
+// already has this table without that column, and CREATE TABLE IF NOT
+// EXISTS is a no-op against it. SQLite's ALTER TABLE ADD COLUMN has no IF
+// NOT EXISTS, so presence is checked via PRAGMA table_info first.
+func (SQLite) EnsureHistoryTable(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version integer, tstamp timestamp, direction text, status text, dirty boolean, parent_version integer)", tableName))
+	if err != nil {
+		return err
+	}
+
+	hasColumn, err := sqliteHasColumn(ctx, db, tableName, "parent_version")
+	if err != nil {
+		return err
+	}
+	if hasColumn {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN parent_version integer", tableName))
+	return err
+}
+
+// sqliteHasColumn reports whether tableName has a column named columnName.
+func sqliteHasColumn(ctx context.Context, db *sql.DB, tableName, columnName string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == columnName {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// EnsureSingleActiveIndex relies on a partial unique index, which SQLite
+// supports natively: only rows matching the predicate are indexed, so at
+// most one status='in_progress' row can ever exist.
+func (SQLite) EnsureSingleActiveIndex(ctx context.Context, db *sql.DB, tableName string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (status) WHERE status = 'in_progress'",
+		singleActiveIndexName(tableName), tableName))
+	return err
+}
+
+func (SQLite) InsertHistory(ctx context.Context, db *sql.DB, tableName string, record HistoryRecord) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, tstamp, direction, status, dirty, parent_version) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?)", tableName),
+		record.Version, record.Direction, record.Status, record.Dirty, record.ParentVersion)
+	return err
+}
+
+func (SQLite) UpdateStatus(ctx context.Context, db *sql.DB, tableName string, version int, status string, dirty bool) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET status=?, dirty=? WHERE version=? AND status='in_progress'", tableName),
+		status, dirty, version)
+	return err
+}
+
+func (SQLite) AllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error) {
+	return queryAllVersions(ctx, db, tableName)
+}
+
+func (SQLite) HasVersion(ctx context.Context, db *sql.DB, tableName string, version int) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE version=?)", tableName), version).Scan(&exists)
+	return exists, err
+}
+
+func (SQLite) HasInProgress(ctx context.Context, db *sql.DB, tableName string) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE status='in_progress')", tableName)).Scan(&exists)
+	return exists, err
+}
+
+func (SQLite) SelectCurrent(ctx context.Context, db *sql.DB, tableName string) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') ORDER BY tstamp DESC LIMIT 1", tableName)).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (SQLite) SelectBefore(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction FROM %s WHERE status IN ('passed', 'complete') AND version < ? ORDER BY tstamp DESC LIMIT 1", tableName), version).
+		Scan(&r.Version, &r.Direction)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
+
+func (SQLite) SelectByVersion(ctx context.Context, db *sql.DB, tableName string, version int) (HistoryRecord, bool, error) {
+	var r HistoryRecord
+	err := db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT version, direction, dirty, parent_version FROM %s WHERE status IN ('passed', 'complete') AND version = ?", tableName), version).
+		Scan(&r.Version, &r.Direction, &r.Dirty, &r.ParentVersion)
+	if err == sql.ErrNoRows {
+		return HistoryRecord{}, false, nil
+	}
+	return r, err == nil, err
+}
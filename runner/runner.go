@@ -0,0 +1,102 @@
+// Package runner lets applications register reversible migrations written
+// in Go alongside voyager's SQL migrations.
+package runner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GoMigration is a single reversible migration implemented in Go. Up and
+// Down run inside the same transaction voyager uses for SQL migrations,
+// unless NoTx is set, in which case NoTxUp/NoTxDown run directly against
+// the database -- required for statements such as CREATE INDEX
+// CONCURRENTLY that Postgres refuses to run inside a transaction.
+type GoMigration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx *sql.Tx) error
+	Down    func(ctx context.Context, tx *sql.Tx) error
+
+	NoTx     bool
+	NoTxUp   func(ctx context.Context, db *sql.DB) error
+	NoTxDown func(ctx context.Context, db *sql.DB) error
+}
+
+// MigrationsRunner is the interface voyager uses to execute a registered Go
+// migration in the given direction ("up" or "down"). A *Registry is the
+// usual implementation.
+type MigrationsRunner interface {
+	// IsNoTx reports whether the migration at version must run outside a
+	// transaction.
+	IsNoTx(version int) bool
+	// RunTx runs the Up or Down callback registered for version inside tx.
+	RunTx(ctx context.Context, tx *sql.Tx, version int, direction string) error
+	// RunNoTx runs the NoTxUp or NoTxDown callback registered for version
+	// directly against db.
+	RunNoTx(ctx context.Context, db *sql.DB, version int, direction string) error
+}
+
+// Registry is a set of Go migrations keyed by version.
+type Registry struct {
+	migrations map[int]GoMigration
+}
+
+func NewRegistry() *Registry {
+	return &Registry{migrations: map[int]GoMigration{}}
+}
+
+// Register adds m to the registry, keyed by m.Version.
+func (r *Registry) Register(m GoMigration) {
+	r.migrations[m.Version] = m
+}
+
+func (r *Registry) IsNoTx(version int) bool {
+	m, ok := r.migrations[version]
+	return ok && m.NoTx
+}
+
+func (r *Registry) RunTx(ctx context.Context, tx *sql.Tx, version int, direction string) error {
+	m, ok := r.migrations[version]
+	if !ok {
+		return fmt.Errorf("no Go migration registered for version %d", version)
+	}
+
+	switch direction {
+	case "up":
+		if m.Up == nil {
+			return fmt.Errorf("Go migration %d (%s) has no Up", version, m.Name)
+		}
+		return m.Up(ctx, tx)
+	case "down":
+		if m.Down == nil {
+			return fmt.Errorf("Go migration %d (%s) has no Down", version, m.Name)
+		}
+		return m.Down(ctx, tx)
+	default:
+		return fmt.Errorf("unknown migration direction %q", direction)
+	}
+}
+
+func (r *Registry) RunNoTx(ctx context.Context, db *sql.DB, version int, direction string) error {
+	m, ok := r.migrations[version]
+	if !ok {
+		return fmt.Errorf("no Go migration registered for version %d", version)
+	}
+
+	switch direction {
+	case "up":
+		if m.NoTxUp == nil {
+			return fmt.Errorf("Go migration %d (%s) has no NoTxUp", version, m.Name)
+		}
+		return m.NoTxUp(ctx, db)
+	case "down":
+		if m.NoTxDown == nil {
+			return fmt.Errorf("Go migration %d (%s) has no NoTxDown", version, m.Name)
+		}
+		return m.NoTxDown(ctx, db)
+	default:
+		return fmt.Errorf("unknown migration direction %q", direction)
+	}
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestRegistry_IsNoTx(t *testing.T) {
+	r := NewRegistry()
+	r.Register(GoMigration{Version: 1, Name: "tx_migration"})
+	r.Register(GoMigration{Version: 2, Name: "notx_migration", NoTx: true})
+
+	if r.IsNoTx(1) {
+		t.Fatal("IsNoTx(1) = true, want false")
+	}
+	if !r.IsNoTx(2) {
+		t.Fatal("IsNoTx(2) = false, want true")
+	}
+	if r.IsNoTx(3) {
+		t.Fatal("IsNoTx(3) for an unregistered version = true, want false")
+	}
+}
+
+func TestRegistry_RunTx_DispatchesUpAndDown(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	r.Register(GoMigration{
+		Version: 1,
+		Name:    "add_widgets",
+		Up:      func(ctx context.Context, tx *sql.Tx) error { ran = append(ran, "up"); return nil },
+		Down:    func(ctx context.Context, tx *sql.Tx) error { ran = append(ran, "down"); return nil },
+	})
+
+	if err := r.RunTx(context.Background(), nil, 1, "up"); err != nil {
+		t.Fatalf("RunTx up: %v", err)
+	}
+	if err := r.RunTx(context.Background(), nil, 1, "down"); err != nil {
+		t.Fatalf("RunTx down: %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "up" || ran[1] != "down" {
+		t.Fatalf("ran = %v, want [up down]", ran)
+	}
+}
+
+func TestRegistry_RunTx_UnregisteredVersionIsAnError(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RunTx(context.Background(), nil, 99, "up"); err == nil {
+		t.Fatal("expected an error for an unregistered version, got nil")
+	}
+}
+
+func TestRegistry_RunTx_MissingDirectionCallbackIsAnError(t *testing.T) {
+	r := NewRegistry()
+	r.Register(GoMigration{Version: 1, Name: "up_only", Up: func(ctx context.Context, tx *sql.Tx) error { return nil }})
+
+	if err := r.RunTx(context.Background(), nil, 1, "down"); err == nil {
+		t.Fatal("expected an error when Down is nil, got nil")
+	}
+}
+
+func TestRegistry_RunTx_UnknownDirectionIsAnError(t *testing.T) {
+	r := NewRegistry()
+	r.Register(GoMigration{Version: 1, Name: "add_widgets", Up: func(ctx context.Context, tx *sql.Tx) error { return nil }})
+
+	if err := r.RunTx(context.Background(), nil, 1, "sideways"); err == nil {
+		t.Fatal("expected an error for an unknown direction, got nil")
+	}
+}
+
+func TestRegistry_RunNoTx_DispatchesUpAndDown(t *testing.T) {
+	var ran []string
+	r := NewRegistry()
+	r.Register(GoMigration{
+		Version:  1,
+		Name:     "create_index_concurrently",
+		NoTx:     true,
+		NoTxUp:   func(ctx context.Context, db *sql.DB) error { ran = append(ran, "up"); return nil },
+		NoTxDown: func(ctx context.Context, db *sql.DB) error { ran = append(ran, "down"); return nil },
+	})
+
+	if err := r.RunNoTx(context.Background(), nil, 1, "up"); err != nil {
+		t.Fatalf("RunNoTx up: %v", err)
+	}
+	if err := r.RunNoTx(context.Background(), nil, 1, "down"); err != nil {
+		t.Fatalf("RunNoTx down: %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "up" || ran[1] != "down" {
+		t.Fatalf("ran = %v, want [up down]", ran)
+	}
+}
+
+func TestRegistry_RunNoTx_UnregisteredVersionIsAnError(t *testing.T) {
+	r := NewRegistry()
+	if err := r.RunNoTx(context.Background(), nil, 99, "up"); err == nil {
+		t.Fatal("expected an error for an unregistered version, got nil")
+	}
+}
+
+func TestRegistry_RunNoTx_MissingDirectionCallbackIsAnError(t *testing.T) {
+	r := NewRegistry()
+	r.Register(GoMigration{Version: 1, Name: "up_only", NoTx: true, NoTxUp: func(ctx context.Context, db *sql.DB) error { return nil }})
+
+	if err := r.RunNoTx(context.Background(), nil, 1, "down"); err == nil {
+		t.Fatal("expected an error when NoTxDown is nil, got nil")
+	}
+}
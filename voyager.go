@@ -1,35 +1,244 @@
 package voyager
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"sort"
 	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/ddadlani/voyager/driver"
 	"github.com/ddadlani/voyager/runner"
 	multierror "github.com/hashicorp/go-multierror"
 	_ "github.com/lib/pq"
 )
 
+// defaultTableName is the table voyager uses to track applied migrations
+// unless overridden with WithTableName.
+const defaultTableName = "migrations_history"
+
 type Migrator interface {
 	CurrentVersion() (int, error)
+	CurrentVersionContext(ctx context.Context) (int, error)
 	SupportedVersion() (int, error)
 	Migrate(version int) error
+	MigrateContext(ctx context.Context, version int) error
 	Up() error
+	UpContext(ctx context.Context) error
 	Migrations() ([]migration, error)
+	Plan(toVersion int, set MigrateSet) ([]PlannedStep, error)
+	PlanContext(ctx context.Context, toVersion int, set MigrateSet) ([]PlannedStep, error)
+	Status() ([]MigrationStatus, error)
+	StatusContext(ctx context.Context) ([]MigrationStatus, error)
+	// IsMigrationInProgress reports whether the history table has a row
+	// stuck in_progress, which only happens if a prior migration attempt
+	// crashed before recording its outcome.
+	IsMigrationInProgress(ctx context.Context) (bool, error)
+	// LatestVersion returns the version at the tip of the applied-migration
+	// chain, after walking every ParentVersion link back to the root to
+	// confirm the chain is intact. It returns an error if a row's parent
+	// is missing from history, which CurrentVersionContext would not
+	// otherwise detect.
+	LatestVersion(ctx context.Context) (int, error)
+}
+
+// MigrateSet configures optional safety checks applied by Plan. Migrate runs
+// unconditionally and has no way to take a MigrateSet, so it never performs
+// this check -- an operator wanting to catch unknown history-table versions
+// before running anything destructive should call Plan first.
+type MigrateSet struct {
+	// IgnoreUnknown skips the check for versions recorded in the history
+	// table that have no corresponding migration on disk. By default that
+	// situation is reported as a MissingMigrationError.
+	IgnoreUnknown bool
+}
+
+// PlanAction describes what Plan intends to do with a given migration.
+type PlanAction int
+
+const (
+	PlanApply PlanAction = iota
+	PlanRollback
+)
+
+// PlannedStep is one migration Plan would apply or roll back, in the order
+// it would run.
+type PlannedStep struct {
+	Version   int
+	Name      string
+	Direction string
+	Action    PlanAction
+}
+
+// MigrationStatus reports whether a single migration version is currently
+// applied to the database.
+type MigrationStatus struct {
+	Version int
+	Name    string
+	Applied bool
+	// Missing is true when this version was recorded in the history table
+	// but has no corresponding migration on disk.
+	Missing bool
+}
+
+// MissingMigrationError is returned by Plan when migrations_history
+// references versions that are absent from the migration source, unless
+// MigrateSet.IgnoreUnknown is set.
+type MissingMigrationError struct {
+	Versions []int
 }
 
-func NewMigrator(db *sql.DB, lockID int, source Source, migrationsRunner runner.MigrationsRunner) Migrator {
+func (e *MissingMigrationError) Error() string {
+	return fmt.Sprintf("migrations_history references migration(s) %v with no corresponding file on disk", e.Versions)
+}
+
+// MigrationInfo identifies a single migration for Observer implementations
+// outside this package, which cannot spell the unexported migration type.
+type MigrationInfo struct {
+	Version   int
+	Name      string
+	Direction string
+}
+
+// Observer receives structured events as a Migrator runs a single migration,
+// for callers that want progress reporting beyond what the returned error
+// conveys. Implementations must not block migration execution for long, as
+// every call happens synchronously on the migration's goroutine.
+type Observer interface {
+	// OnStart fires once, immediately before a migration is attempted.
+	OnStart(m MigrationInfo)
+	// OnStatement fires before each statement of a multi-statement SQL
+	// migration is executed, and once (as statement 1 of 1) for Go
+	// migrations and single-statement SQL migrations.
+	OnStatement(idx, total int)
+	// OnComplete fires once a migration has been applied and its history
+	// row marked complete, reporting how long it took.
+	OnComplete(m MigrationInfo, dur time.Duration)
+	// OnFailure fires once, with the error that caused a migration to be
+	// recorded as failed.
+	OnFailure(m MigrationInfo, err error)
+}
+
+// lagerObserver is the default Observer, logging each event to a
+// lager.Logger rather than requiring callers to opt in to progress
+// reporting.
+type lagerObserver struct {
+	logger lager.Logger
+}
+
+func (o lagerObserver) OnStart(m MigrationInfo) {
+	o.logger.Info("migration-start", lager.Data{"version": m.Version, "name": m.Name, "direction": m.Direction})
+}
+
+func (o lagerObserver) OnStatement(idx, total int) {
+	o.logger.Debug("migration-statement", lager.Data{"statement": idx, "of": total})
+}
+
+func (o lagerObserver) OnComplete(m MigrationInfo, dur time.Duration) {
+	o.logger.Info("migration-complete", lager.Data{"version": m.Version, "name": m.Name, "duration": dur.String()})
+}
+
+func (o lagerObserver) OnFailure(m MigrationInfo, err error) {
+	o.logger.Error("migration-failed", err, lager.Data{"version": m.Version, "name": m.Name})
+}
+
+// MigratorConfig customizes where and how a Migrator stores its history,
+// and how it coordinates with other instances sharing a database. The zero
+// value tracks history in an unqualified "migrations_history" table, i.e.
+// one in the connection's default schema, and
+// derives a lock ID from (SchemaName, TableName), matching voyager's
+// historical single-application behavior.
+type MigratorConfig struct {
+	// TableName is the history table voyager reads and writes. Defaults to
+	// "migrations_history".
+	TableName string
+	// SchemaName, if set, qualifies TableName so two applications with
+	// independent migrations_history tables can share a database.
+	SchemaName string
+	// DisableCreateTable skips the CREATE TABLE IF NOT EXISTS voyager
+	// otherwise runs on every Migrate, for deployments that provision the
+	// history table out of band.
+	DisableCreateTable bool
+	// LockID is the advisory-lock identifier used to serialize concurrent
+	// migrators. When zero, it is derived by hashing (SchemaName,
+	// TableName), so two applications naturally get independent locks as
+	// long as they use distinct table/schema names.
+	LockID int
+	// Observer receives structured events as each migration runs. Defaults
+	// to logging them via a lager.Logger named "migrations".
+	Observer Observer
+}
+
+type MigratorOption func(*MigratorConfig)
+
+func WithTableName(name string) MigratorOption {
+	return func(c *MigratorConfig) { c.TableName = name }
+}
+
+func WithSchemaName(name string) MigratorOption {
+	return func(c *MigratorConfig) { c.SchemaName = name }
+}
+
+func WithDisableCreateTable() MigratorOption {
+	return func(c *MigratorConfig) { c.DisableCreateTable = true }
+}
+
+func WithLockID(lockID int) MigratorOption {
+	return func(c *MigratorConfig) { c.LockID = lockID }
+}
+
+// WithObserver overrides the default lager-backed Observer, e.g. to forward
+// migration progress to a metrics system or a caller-visible progress bar.
+func WithObserver(o Observer) MigratorOption {
+	return func(c *MigratorConfig) { c.Observer = o }
+}
+
+// deriveLockID computes a stable advisory-lock ID from a schema/table pair
+// so that two independently-configured migrators collide only if they
+// target the same history table.
+func deriveLockID(schemaName, tableName string) int {
+	h := fnv.New32a()
+	h.Write([]byte(schemaName + "." + tableName))
+	return int(h.Sum32())
+}
+
+// NewMigrator constructs a Migrator that auto-detects the SQL dialect to
+// use from db's registered driver. Use NewMigratorWithDriver to override
+// detection, e.g. in tests or for drivers Detect doesn't recognise.
+func NewMigrator(db *sql.DB, source Source, migrationsRunner runner.MigrationsRunner, opts ...MigratorOption) Migrator {
+	return NewMigratorWithDriver(db, source, migrationsRunner, driver.Detect(db), opts...)
+}
+
+func NewMigratorWithDriver(db *sql.DB, source Source, migrationsRunner runner.MigrationsRunner, dbDriver driver.Driver, opts ...MigratorOption) Migrator {
+	config := MigratorConfig{TableName: defaultTableName}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.LockID == 0 {
+		config.LockID = deriveLockID(config.SchemaName, config.TableName)
+	}
+	logger := lager.NewLogger("migrations")
+	if config.Observer == nil {
+		config.Observer = lagerObserver{logger: logger}
+	}
+
 	return &migrator{
-		db,
-		lockID,
-		lager.NewLogger("migrations"),
-		source,
-		migrationsRunner,
-		&sync.Mutex{},
+		db:                 db,
+		lockID:             config.LockID,
+		logger:             logger,
+		source:             source,
+		goMigrationsRunner: migrationsRunner,
+		dbDriver:           dbDriver,
+		tableName:          config.TableName,
+		schemaName:         config.SchemaName,
+		qualifiedTable:     dbDriver.QualifiedTableName(config.SchemaName, config.TableName),
+		disableCreateTable: config.DisableCreateTable,
+		observer:           config.Observer,
+		Mutex:              &sync.Mutex{},
 	}
 }
 
@@ -39,6 +248,12 @@ type migrator struct {
 	logger             lager.Logger
 	source             Source
 	goMigrationsRunner runner.MigrationsRunner
+	dbDriver           driver.Driver
+	tableName          string
+	schemaName         string
+	qualifiedTable     string
+	disableCreateTable bool
+	observer           Observer
 	*sync.Mutex
 }
 
@@ -58,64 +273,112 @@ func (m *migrator) SupportedVersion() (int, error) {
 }
 
 func (m *migrator) CurrentVersion() (int, error) {
-	var currentVersion int
-	var direction string
-	var dirty bool
-	err := m.db.QueryRow("SELECT version, direction, dirty FROM migrations_history WHERE status!='failed' ORDER BY tstamp DESC LIMIT 1").Scan(&currentVersion, &direction, &dirty)
+	return m.CurrentVersionContext(context.Background())
+}
+
+func (m *migrator) CurrentVersionContext(ctx context.Context) (int, error) {
+	record, found, err := m.dbDriver.SelectCurrent(ctx, m.db, m.qualifiedTable)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil
-		}
 		return -1, err
 	}
+	if !found {
+		return 0, nil
+	}
 
-	if dirty {
+	if record.Dirty {
 		return -1, errors.New("could not determine current migration version. Database is in a dirty state")
 	}
 
-	for direction == "down" {
-		err := m.db.QueryRow("SELECT version, direction FROM migrations_history WHERE status!='failed' AND version < $1 ORDER BY tstamp DESC LIMIT 1", currentVersion).Scan(&currentVersion, &direction)
+	for record.Direction == "down" {
+		record, found, err = m.dbDriver.SelectBefore(ctx, m.db, m.qualifiedTable, record.Version)
 		if err != nil {
 			return -1, multierror.Append(errors.New("could not determine current migration version"), err)
 		}
+		if !found {
+			return -1, errors.New("could not determine current migration version")
+		}
+	}
+	return record.Version, nil
+}
+
+func (m *migrator) IsMigrationInProgress(ctx context.Context) (bool, error) {
+	return m.dbDriver.HasInProgress(ctx, m.db, m.qualifiedTable)
+}
+
+func (m *migrator) LatestVersion(ctx context.Context) (int, error) {
+	record, found, err := m.dbDriver.SelectCurrent(ctx, m.db, m.qualifiedTable)
+	if err != nil {
+		return -1, err
+	}
+	if !found {
+		return 0, nil
+	}
+
+	head := record.Version
+	for record.ParentVersion != 0 {
+		parent, found, err := m.dbDriver.SelectByVersion(ctx, m.db, m.qualifiedTable, record.ParentVersion)
+		if err != nil {
+			return -1, err
+		}
+		if !found {
+			return -1, fmt.Errorf("migration chain broken: version %d has no recorded parent %d", record.Version, record.ParentVersion)
+		}
+		record = parent
 	}
-	return currentVersion, nil
+	return head, nil
 }
 
 func (m *migrator) Migrate(toVersion int) error {
+	return m.MigrateContext(context.Background(), toVersion)
+}
 
-	acquired, err := m.acquireLock()
+func (m *migrator) MigrateContext(ctx context.Context, toVersion int) error {
+
+	acquired, err := m.acquireLock(ctx)
 	if err != nil {
 		return err
 	}
 
 	if acquired {
-		defer m.releaseLock()
+		defer m.releaseLock(ctx)
 	}
 
-	existingDBVersion, err := m.migrateFromOldSchema()
+	existingDBVersion, err := m.migrateFromOldSchema(ctx)
 	if err != nil {
 		return err
 	}
 
-	_, err = m.db.Exec("CREATE TABLE IF NOT EXISTS migrations_history (version bigint, tstamp timestamp with time zone, direction varchar, status varchar, dirty boolean)")
-	if err != nil {
-		return err
+	if !m.disableCreateTable {
+		err = m.dbDriver.EnsureHistoryTable(ctx, m.db, m.qualifiedTable)
+		if err != nil {
+			return err
+		}
+
+		err = m.dbDriver.EnsureSingleActiveIndex(ctx, m.db, m.qualifiedTable)
+		if err != nil {
+			return err
+		}
 	}
 
 	if existingDBVersion > 0 {
-		var containsOldMigrationInfo bool
-		err = m.db.QueryRow("SELECT EXISTS (SELECT 1 FROM migrations_history where version=$1)", existingDBVersion).Scan(&containsOldMigrationInfo)
+		containsOldMigrationInfo, err := m.dbDriver.HasVersion(ctx, m.db, m.qualifiedTable, existingDBVersion)
+		if err != nil {
+			return err
+		}
 
 		if !containsOldMigrationInfo {
-			_, err = m.db.Exec("INSERT INTO migrations_history (version, tstamp, direction, status, dirty) VALUES ($1, current_timestamp, 'up', 'passed', false)", existingDBVersion)
+			err = m.dbDriver.InsertHistory(ctx, m.db, m.qualifiedTable, driver.HistoryRecord{
+				Version:   existingDBVersion,
+				Direction: "up",
+				Status:    "passed",
+			})
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	currentVersion, err := m.CurrentVersion()
+	currentVersion, err := m.CurrentVersionContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -128,7 +391,7 @@ func (m *migrator) Migrate(toVersion int) error {
 	if currentVersion <= toVersion {
 		for _, migration := range migrations {
 			if currentVersion < migration.Version && migration.Version <= toVersion && migration.Direction == "up" {
-				err = m.runMigration(migration)
+				err = m.runMigration(ctx, migration)
 				if err != nil {
 					return err
 				}
@@ -137,7 +400,7 @@ func (m *migrator) Migrate(toVersion int) error {
 	} else {
 		for i := len(migrations) - 1; i >= 0; i-- {
 			if currentVersion >= migrations[i].Version && migrations[i].Version > toVersion && migrations[i].Direction == "down" {
-				err = m.runMigration(migrations[i])
+				err = m.runMigration(ctx, migrations[i])
 				if err != nil {
 					return err
 				}
@@ -145,7 +408,7 @@ func (m *migrator) Migrate(toVersion int) error {
 			}
 		}
 
-		err = m.migrateToOldSchema(toVersion)
+		err = m.migrateToOldSchema(ctx, toVersion)
 		if err != nil {
 			return err
 		}
@@ -169,42 +432,99 @@ type migration struct {
 	Strategy   Strategy
 }
 
-func (m *migrator) recordMigrationFailure(migration migration, err error, dirty bool) error {
-	_, dbErr := m.db.Exec("INSERT INTO migrations_history (version, tstamp, direction, status, dirty) VALUES ($1, current_timestamp, $2, 'failed', $3)", migration.Version, migration.Direction, dirty)
+// info converts migration to the exported type Observer implementations
+// outside this package deal in.
+func (m migration) info() MigrationInfo {
+	return MigrationInfo{Version: m.Version, Name: m.Name, Direction: m.Direction}
+}
+
+func (m *migrator) recordMigrationFailure(ctx context.Context, migration migration, err error, dirty bool) error {
+	m.observer.OnFailure(migration.info(), err)
+	dbErr := m.dbDriver.UpdateStatus(ctx, m.db, m.qualifiedTable, migration.Version, "failed", dirty)
 	return multierror.Append(fmt.Errorf("Migration '%s' failed: %v", migration.Name, err), dbErr)
 }
 
-func (m *migrator) runMigration(migration migration) error {
-	var err error
+// runMigration records migration as in_progress -- with a parent pointer to
+// the version that was current beforehand -- before attempting it, so a
+// crash mid-migration is detectable via IsMigrationInProgress instead of
+// leaving history silently out of sync with the database.
+func (m *migrator) runMigration(ctx context.Context, migration migration) error {
+	parentVersion, err := m.CurrentVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.dbDriver.InsertHistory(ctx, m.db, m.qualifiedTable, driver.HistoryRecord{
+		Version:       migration.Version,
+		Direction:     migration.Direction,
+		Status:        "in_progress",
+		ParentVersion: parentVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("could not record migration '%s' as in progress: %v", migration.Name, err)
+	}
+
+	start := time.Now()
+	m.observer.OnStart(migration.info())
 
 	switch migration.Strategy {
 	case GoMigration:
-		err = m.goMigrationsRunner.Run(migration.Name)
-		if err != nil {
-			return m.recordMigrationFailure(migration, err, false)
+		m.observer.OnStatement(1, 1)
+		if m.goMigrationsRunner.IsNoTx(migration.Version) {
+			err = m.goMigrationsRunner.RunNoTx(ctx, m.db, migration.Version, migration.Direction)
+			if err != nil {
+				return m.recordMigrationFailure(ctx, migration, err, true)
+			}
+		} else {
+			tx, txErr := m.db.BeginTx(ctx, nil)
+			if txErr != nil {
+				return m.recordMigrationFailure(ctx, migration, txErr, false)
+			}
+
+			err = m.goMigrationsRunner.RunTx(ctx, tx, migration.Version, migration.Direction)
+			if err != nil {
+				tx.Rollback()
+				return m.recordMigrationFailure(ctx, migration, err, false)
+			}
+
+			err = tx.Commit()
+			if err != nil {
+				return m.recordMigrationFailure(ctx, migration, err, false)
+			}
 		}
 	case SQLTransaction:
-		tx, err := m.db.Begin()
-		for _, statement := range migration.Statements {
-			_, err = tx.Exec(statement)
-			if err != nil {
+		tx, txErr := m.db.BeginTx(ctx, nil)
+		if txErr != nil {
+			return m.recordMigrationFailure(ctx, migration, txErr, false)
+		}
+
+		for idx, statement := range migration.Statements {
+			m.observer.OnStatement(idx+1, len(migration.Statements))
+			if _, execErr := tx.ExecContext(ctx, statement); execErr != nil {
 				tx.Rollback()
-				err = multierror.Append(fmt.Errorf("Transaction %v failed, rolled back the migration", statement), err)
-				if err != nil {
-					return m.recordMigrationFailure(migration, err, false)
-				}
+				execErr = multierror.Append(fmt.Errorf("Transaction %v failed, rolled back the migration", statement), execErr)
+				return m.recordMigrationFailure(ctx, migration, execErr, false)
 			}
 		}
+
 		err = tx.Commit()
+		if err != nil {
+			return m.recordMigrationFailure(ctx, migration, err, false)
+		}
 	case SQLNoTransaction:
-		_, err = m.db.Exec(migration.Statements[0])
+		m.observer.OnStatement(1, 1)
+		_, err = m.db.ExecContext(ctx, migration.Statements[0])
 		if err != nil {
-			return m.recordMigrationFailure(migration, err, true)
+			return m.recordMigrationFailure(ctx, migration, err, true)
 		}
 	}
 
-	_, err = m.db.Exec("INSERT INTO migrations_history (version, tstamp, direction, status, dirty) VALUES ($1, current_timestamp, $2, 'passed', false)", migration.Version, migration.Direction)
-	return err
+	err = m.dbDriver.UpdateStatus(ctx, m.db, m.qualifiedTable, migration.Version, "complete", false)
+	if err != nil {
+		return err
+	}
+	m.observer.OnComplete(migration.info(), time.Since(start))
+	return nil
 }
 
 func (m *migrator) Migrations() ([]migration, error) {
@@ -224,19 +544,151 @@ func (m *migrator) Migrations() ([]migration, error) {
 	return migrationList, nil
 }
 
+// Plan reports the ordered list of migrations that MigrateContext would
+// apply or roll back in order to reach toVersion, without running any of
+// them.
+func (m *migrator) Plan(toVersion int, set MigrateSet) ([]PlannedStep, error) {
+	return m.PlanContext(context.Background(), toVersion, set)
+}
+
+func (m *migrator) PlanContext(ctx context.Context, toVersion int, set MigrateSet) ([]PlannedStep, error) {
+	currentVersion, err := m.CurrentVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if !set.IgnoreUnknown {
+		missing, err := m.missingVersions(ctx, migrations)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			return nil, &MissingMigrationError{Versions: missing}
+		}
+	}
+
+	steps := []PlannedStep{}
+	if currentVersion <= toVersion {
+		for _, mg := range migrations {
+			if currentVersion < mg.Version && mg.Version <= toVersion && mg.Direction == "up" {
+				steps = append(steps, PlannedStep{Version: mg.Version, Name: mg.Name, Direction: mg.Direction, Action: PlanApply})
+			}
+		}
+	} else {
+		for i := len(migrations) - 1; i >= 0; i-- {
+			if currentVersion >= migrations[i].Version && migrations[i].Version > toVersion && migrations[i].Direction == "down" {
+				steps = append(steps, PlannedStep{Version: migrations[i].Version, Name: migrations[i].Name, Direction: migrations[i].Direction, Action: PlanRollback})
+			}
+		}
+	}
+
+	return steps, nil
+}
+
+// Status reports, for every migration known on disk, whether it is
+// currently applied, plus any versions recorded in the history table that
+// are no longer present on disk.
+func (m *migrator) Status() ([]MigrationStatus, error) {
+	return m.StatusContext(context.Background())
+}
+
+func (m *migrator) StatusContext(ctx context.Context) ([]MigrationStatus, error) {
+	currentVersion, err := m.CurrentVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	seen := map[int]bool{}
+	for _, mg := range migrations {
+		if mg.Direction != "up" || seen[mg.Version] {
+			continue
+		}
+		seen[mg.Version] = true
+		statuses = append(statuses, MigrationStatus{
+			Version: mg.Version,
+			Name:    mg.Name,
+			Applied: mg.Version <= currentVersion,
+		})
+	}
+
+	missing, err := m.missingVersions(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range missing {
+		statuses = append(statuses, MigrationStatus{Version: v, Applied: true, Missing: true})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// missingVersions returns the versions recorded in the history table that
+// have no corresponding entry in migrations.
+func (m *migrator) missingVersions(ctx context.Context, migrations []migration) ([]int, error) {
+	historyExists, err := m.dbDriver.TableExists(ctx, m.db, m.schemaName, m.tableName)
+	if err != nil {
+		return nil, err
+	}
+	if !historyExists {
+		return nil, nil
+	}
+
+	known := map[int]bool{}
+	for _, mg := range migrations {
+		known[mg.Version] = true
+	}
+
+	recorded, err := m.dbDriver.AllVersions(ctx, m.db, m.qualifiedTable)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []int{}
+	for _, v := range recorded {
+		if !known[v] {
+			missing = append(missing, v)
+		}
+	}
+	return missing, nil
+}
+
 func (m *migrator) Up() error {
+	return m.UpContext(context.Background())
+}
+
+func (m *migrator) UpContext(ctx context.Context) error {
 	migrations, err := m.Migrations()
 	if err != nil {
 		return err
 	}
-	return m.Migrate(migrations[len(migrations)-1].Version)
+	return m.MigrateContext(ctx, migrations[len(migrations)-1].Version)
 }
 
-func (m *migrator) acquireLock() (bool, error) {
-	var acquired bool
+// acquireLock blocks until the dialect's database-wide lock identified by
+// m.lockID is acquired or ctx is cancelled, retrying once a second in
+// between.
+func (m *migrator) acquireLock(ctx context.Context) (bool, error) {
 	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		default:
+		}
+
 		m.Lock()
-		err := m.db.QueryRow(`SELECT pg_try_advisory_lock($1)`, m.lockID).Scan(&acquired)
+		acquired, err := m.dbDriver.AcquireLock(ctx, m.db, m.lockID)
 
 		if err != nil {
 			m.Unlock()
@@ -249,16 +701,25 @@ func (m *migrator) acquireLock() (bool, error) {
 		}
 
 		m.Unlock()
-		time.Sleep(1 * time.Second)
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
-func (m *migrator) releaseLock() (bool, error) {
-
-	var released bool
+func (m *migrator) releaseLock(ctx context.Context) (bool, error) {
 	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		default:
+		}
+
 		m.Lock()
-		err := m.db.QueryRow(`SELECT pg_advisory_unlock($1)`, m.lockID).Scan(&released)
+		released, err := m.dbDriver.ReleaseLock(ctx, m.db, m.lockID)
 
 		if err != nil {
 			m.Unlock()
@@ -271,7 +732,12 @@ func (m *migrator) releaseLock() (bool, error) {
 		}
 
 		m.Unlock()
-		time.Sleep(1 * time.Second)
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 }
 
@@ -284,19 +750,40 @@ func sortMigrations(migrationList []migration) {
 }
 
 func CheckTableExist(db *sql.DB, tableName string) bool {
+	return CheckTableExistContext(context.Background(), db, tableName)
+}
+
+func CheckTableExistContext(ctx context.Context, db *sql.DB, tableName string) bool {
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS ( SELECT 1 FROM information_schema.tables WHERE table_name=$1)", tableName).Scan(&exists)
+	err := db.QueryRowContext(ctx, "SELECT EXISTS ( SELECT 1 FROM information_schema.tables WHERE table_name=$1)", tableName).Scan(&exists)
 	return err != nil || exists
 }
 
-func (m *migrator) migrateFromOldSchema() (int, error) {
-	if !CheckTableExist(m.db, "old_schema") || CheckTableExist(m.db, "migrations_history") {
+// migrateFromOldSchema and migrateToOldSchema bridge voyager's original,
+// Postgres-only "old_schema" table and issue raw Postgres SQL against it, so
+// both early-return on any other dbDriver -- other dialects have no legacy
+// deployments to migrate from, and $1-style placeholders would be invalid
+// against them anyway.
+func (m *migrator) migrateFromOldSchema(ctx context.Context) (int, error) {
+	if _, ok := m.dbDriver.(driver.Postgres); !ok {
+		return 0, nil
+	}
+
+	oldSchemaExists, err := m.dbDriver.TableExists(ctx, m.db, "", "old_schema")
+	if err != nil {
+		return 0, err
+	}
+	historyExists, err := m.dbDriver.TableExists(ctx, m.db, m.schemaName, m.tableName)
+	if err != nil {
+		return 0, err
+	}
+	if !oldSchemaExists || historyExists {
 		return 0, nil
 	}
 
 	var isDirty = false
 	var existingVersion int
-	err := m.db.QueryRow("SELECT dirty, version FROM old_schema LIMIT 1").Scan(&isDirty, &existingVersion)
+	err = m.db.QueryRowContext(ctx, "SELECT dirty, version FROM old_schema LIMIT 1").Scan(&isDirty, &existingVersion)
 	if err != nil {
 		return 0, err
 	}
@@ -308,7 +795,7 @@ func (m *migrator) migrateFromOldSchema() (int, error) {
 	return existingVersion, nil
 }
 
-func (m *migrator) migrateToOldSchema(toVersion int) error {
+func (m *migrator) migrateToOldSchema(ctx context.Context, toVersion int) error {
 	newMigrationsHistoryFirstVersion := 1532706545
 	oldMigrationsSchemaLatestVersion := 101010
 
@@ -316,18 +803,27 @@ func (m *migrator) migrateToOldSchema(toVersion int) error {
 		return nil
 	}
 
-	if !CheckTableExist(m.db, "old_schema") {
-		_, err := m.db.Exec("CREATE TABLE old_schema (version bigint, dirty boolean)")
+	if _, ok := m.dbDriver.(driver.Postgres); !ok {
+		return nil
+	}
+
+	oldSchemaExists, err := m.dbDriver.TableExists(ctx, m.db, "", "old_schema")
+	if err != nil {
+		return err
+	}
+
+	if !oldSchemaExists {
+		_, err := m.db.ExecContext(ctx, "CREATE TABLE old_schema (version bigint, dirty boolean)")
 		if err != nil {
 			return err
 		}
 
-		_, err = m.db.Exec("INSERT INTO old_schema (version, dirty) VALUES ($1, false)", oldMigrationsSchemaLatestVersion)
+		_, err = m.db.ExecContext(ctx, "INSERT INTO old_schema (version, dirty) VALUES ($1, false)", oldMigrationsSchemaLatestVersion)
 		if err != nil {
 			return err
 		}
 	} else {
-		_, err := m.db.Exec("UPDATE old_schema SET version=$1, dirty=false", oldMigrationsSchemaLatestVersion)
+		_, err := m.db.ExecContext(ctx, "UPDATE old_schema SET version=$1, dirty=false", oldMigrationsSchemaLatestVersion)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,410 @@
+package voyager
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/ddadlani/voyager/driver"
+	"github.com/ddadlani/voyager/runner"
+)
+
+// fakeDriver is an in-memory driver.Driver used to exercise migrator logic
+// without a real database.
+type fakeDriver struct {
+	history []driver.HistoryRecord
+}
+
+func (f *fakeDriver) AcquireLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	return true, nil
+}
+func (f *fakeDriver) ReleaseLock(ctx context.Context, db *sql.DB, lockID int) (bool, error) {
+	return true, nil
+}
+func (f *fakeDriver) QualifiedTableName(schema, table string) string { return table }
+func (f *fakeDriver) TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error) {
+	return true, nil
+}
+func (f *fakeDriver) EnsureHistoryTable(ctx context.Context, db *sql.DB, tableName string) error {
+	return nil
+}
+func (f *fakeDriver) EnsureSingleActiveIndex(ctx context.Context, db *sql.DB, tableName string) error {
+	return nil
+}
+
+func (f *fakeDriver) InsertHistory(ctx context.Context, db *sql.DB, tableName string, record driver.HistoryRecord) error {
+	f.history = append(f.history, record)
+	return nil
+}
+
+func (f *fakeDriver) UpdateStatus(ctx context.Context, db *sql.DB, tableName string, version int, status string, dirty bool) error {
+	for i := range f.history {
+		if f.history[i].Version == version && f.history[i].Status == "in_progress" {
+			f.history[i].Status = status
+			f.history[i].Dirty = dirty
+		}
+	}
+	return nil
+}
+
+func (f *fakeDriver) HasVersion(ctx context.Context, db *sql.DB, tableName string, version int) (bool, error) {
+	for _, r := range f.history {
+		if r.Version == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeDriver) HasInProgress(ctx context.Context, db *sql.DB, tableName string) (bool, error) {
+	for _, r := range f.history {
+		if r.Status == "in_progress" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeDriver) SelectCurrent(ctx context.Context, db *sql.DB, tableName string) (driver.HistoryRecord, bool, error) {
+	for i := len(f.history) - 1; i >= 0; i-- {
+		if f.history[i].Status == "passed" || f.history[i].Status == "complete" {
+			return f.history[i], true, nil
+		}
+	}
+	return driver.HistoryRecord{}, false, nil
+}
+
+func (f *fakeDriver) SelectBefore(ctx context.Context, db *sql.DB, tableName string, version int) (driver.HistoryRecord, bool, error) {
+	for i := len(f.history) - 1; i >= 0; i-- {
+		r := f.history[i]
+		if (r.Status == "passed" || r.Status == "complete") && r.Version < version {
+			return r, true, nil
+		}
+	}
+	return driver.HistoryRecord{}, false, nil
+}
+
+func (f *fakeDriver) SelectByVersion(ctx context.Context, db *sql.DB, tableName string, version int) (driver.HistoryRecord, bool, error) {
+	for _, r := range f.history {
+		if r.Version == version && (r.Status == "passed" || r.Status == "complete") {
+			return r, true, nil
+		}
+	}
+	return driver.HistoryRecord{}, false, nil
+}
+
+func (f *fakeDriver) AllVersions(ctx context.Context, db *sql.DB, tableName string) ([]int, error) {
+	var versions []int
+	for _, r := range f.history {
+		versions = append(versions, r.Version)
+	}
+	return versions, nil
+}
+
+// fakeObserver records the MigrationInfo events it receives, demonstrating
+// that Observer is implementable from outside the voyager package using
+// only exported types.
+type fakeObserver struct {
+	started   []MigrationInfo
+	completed []MigrationInfo
+	failed    []MigrationInfo
+}
+
+func (o *fakeObserver) OnStart(m MigrationInfo)    { o.started = append(o.started, m) }
+func (o *fakeObserver) OnStatement(idx, total int) {}
+func (o *fakeObserver) OnComplete(m MigrationInfo, dur time.Duration) {
+	o.completed = append(o.completed, m)
+}
+func (o *fakeObserver) OnFailure(m MigrationInfo, err error) { o.failed = append(o.failed, m) }
+
+func newTestMigrator(db *sql.DB, fd *fakeDriver, obs Observer) *migrator {
+	return &migrator{
+		db:                 db,
+		dbDriver:           fd,
+		tableName:          defaultTableName,
+		qualifiedTable:     defaultTableName,
+		goMigrationsRunner: runner.NewRegistry(),
+		observer:           obs,
+		Mutex:              &sync.Mutex{},
+	}
+}
+
+func TestRunMigration_ReportsMigrationInfoToObserver(t *testing.T) {
+	goRunner := runner.NewRegistry()
+	goRunner.Register(runner.GoMigration{
+		Version:  1,
+		Name:     "add_widgets",
+		NoTx:     true,
+		NoTxUp:   func(ctx context.Context, db *sql.DB) error { return nil },
+		NoTxDown: func(ctx context.Context, db *sql.DB) error { return nil },
+	})
+
+	fd := &fakeDriver{}
+	obs := &fakeObserver{}
+	m := newTestMigrator(nil, fd, obs)
+	m.goMigrationsRunner = goRunner
+
+	mg := migration{Name: "add_widgets", Version: 1, Direction: "up", Strategy: GoMigration}
+	if err := m.runMigration(context.Background(), mg); err != nil {
+		t.Fatalf("runMigration: %v", err)
+	}
+
+	if len(obs.started) != 1 || obs.started[0].Version != 1 || obs.started[0].Name != "add_widgets" {
+		t.Fatalf("OnStart did not receive the expected MigrationInfo: %+v", obs.started)
+	}
+	if len(obs.completed) != 1 || obs.completed[0].Direction != "up" {
+		t.Fatalf("OnComplete did not receive the expected MigrationInfo: %+v", obs.completed)
+	}
+}
+
+// stubConn is a minimal database/sql/driver.Conn whose Begin/Commit/Exec
+// outcomes are configured per test, used to drive runMigration's
+// SQLTransaction branch without a real database.
+type stubConn struct {
+	beginErr  error
+	execErr   error
+	commitErr error
+}
+
+func (c *stubConn) Prepare(query string) (sqldriver.Stmt, error) {
+	return nil, errors.New("stubConn: Prepare not supported")
+}
+func (c *stubConn) Close() error { return nil }
+func (c *stubConn) Begin() (sqldriver.Tx, error) {
+	if c.beginErr != nil {
+		return nil, c.beginErr
+	}
+	return &stubTx{commitErr: c.commitErr}, nil
+}
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []sqldriver.NamedValue) (sqldriver.Result, error) {
+	if c.execErr != nil {
+		return nil, c.execErr
+	}
+	return sqldriver.ResultNoRows, nil
+}
+
+type stubTx struct{ commitErr error }
+
+func (t *stubTx) Commit() error   { return t.commitErr }
+func (t *stubTx) Rollback() error { return nil }
+
+type stubDriver struct{ conn *stubConn }
+
+func (d *stubDriver) Open(name string) (sqldriver.Conn, error) { return d.conn, nil }
+
+var stubDriverSeq int64
+
+// openStubDB registers and opens a *sql.DB backed by conn, under a
+// freshly-generated driver name so different tests don't collide on
+// sql.Register.
+func openStubDB(t *testing.T, conn *stubConn) *sql.DB {
+	t.Helper()
+	name := fmt.Sprintf("voyager-stub-%d", atomic.AddInt64(&stubDriverSeq, 1))
+	sql.Register(name, &stubDriver{conn: conn})
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRunMigration_SQLTransactionBeginFailureIsReported(t *testing.T) {
+	db := openStubDB(t, &stubConn{beginErr: errors.New("connection refused")})
+	fd := &fakeDriver{}
+	m := newTestMigrator(db, fd, lagerObserver{logger: lagertest.NewTestLogger("test")})
+
+	mg := migration{Name: "broken", Version: 1, Direction: "up", Strategy: SQLTransaction, Statements: []string{"SELECT 1"}}
+	if err := m.runMigration(context.Background(), mg); err == nil {
+		t.Fatal("expected runMigration to return an error when BeginTx fails, got nil")
+	}
+
+	for _, r := range fd.history {
+		if r.Version == 1 && r.Status == "complete" {
+			t.Fatal("migration recorded complete despite BeginTx failing")
+		}
+	}
+}
+
+func TestRunMigration_SQLTransactionCommitFailureIsReported(t *testing.T) {
+	db := openStubDB(t, &stubConn{commitErr: errors.New("commit failed")})
+	fd := &fakeDriver{}
+	m := newTestMigrator(db, fd, lagerObserver{logger: lagertest.NewTestLogger("test")})
+
+	mg := migration{Name: "broken-commit", Version: 1, Direction: "up", Strategy: SQLTransaction, Statements: []string{"SELECT 1"}}
+	if err := m.runMigration(context.Background(), mg); err == nil {
+		t.Fatal("expected runMigration to return an error when Commit fails, got nil")
+	}
+
+	for _, r := range fd.history {
+		if r.Version == 1 && r.Status == "complete" {
+			t.Fatal("migration recorded complete despite Commit failing")
+		}
+	}
+}
+
+func TestLatestVersion_WalksParentChainToRoot(t *testing.T) {
+	fd := &fakeDriver{history: []driver.HistoryRecord{
+		{Version: 1, Direction: "up", Status: "complete", ParentVersion: 0},
+		{Version: 2, Direction: "up", Status: "complete", ParentVersion: 1},
+		{Version: 3, Direction: "up", Status: "complete", ParentVersion: 2},
+	}}
+	m := newTestMigrator(nil, fd, &fakeObserver{})
+
+	got, err := m.LatestVersion(context.Background())
+	if err != nil {
+		t.Fatalf("LatestVersion: %v", err)
+	}
+	if got != 3 {
+		t.Fatalf("LatestVersion = %d, want 3", got)
+	}
+}
+
+func TestMissingMigrationError_Error(t *testing.T) {
+	err := &MissingMigrationError{Versions: []int{3, 7}}
+	if got := err.Error(); !contains(got, "3") || !contains(got, "7") {
+		t.Fatalf("Error() = %q, want it to mention both missing versions", got)
+	}
+}
+
+func contains(haystack, needle string) bool {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if haystack[i:i+len(needle)] == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMissingVersions_ReportsRecordedVersionsAbsentFromDisk(t *testing.T) {
+	fd := &fakeDriver{history: []driver.HistoryRecord{
+		{Version: 1, Direction: "up", Status: "complete"},
+		{Version: 2, Direction: "up", Status: "complete"},
+		{Version: 3, Direction: "up", Status: "complete"},
+	}}
+	m := newTestMigrator(nil, fd, &fakeObserver{})
+
+	onDisk := []migration{
+		{Version: 1, Name: "first", Direction: "up"},
+		{Version: 3, Name: "third", Direction: "up"},
+	}
+
+	missing, err := m.missingVersions(context.Background(), onDisk)
+	if err != nil {
+		t.Fatalf("missingVersions: %v", err)
+	}
+	if len(missing) != 1 || missing[0] != 2 {
+		t.Fatalf("missingVersions = %v, want [2]", missing)
+	}
+}
+
+func TestMissingVersions_NoHistoryTableMeansNothingMissing(t *testing.T) {
+	fd := &noHistoryTableDriver{fakeDriver: fakeDriver{}}
+	m := newTestMigrator(nil, fd, &fakeObserver{})
+
+	missing, err := m.missingVersions(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("missingVersions: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("missingVersions = %v, want none", missing)
+	}
+}
+
+// noHistoryTableDriver overrides fakeDriver.TableExists to report that the
+// history table has never been created, e.g. for a migrator that hasn't run
+// Migrate yet.
+type noHistoryTableDriver struct {
+	fakeDriver
+}
+
+func (d *noHistoryTableDriver) TableExists(ctx context.Context, db *sql.DB, schema, tableName string) (bool, error) {
+	return false, nil
+}
+
+func TestMigratorOptions_SetExpectedConfigFields(t *testing.T) {
+	obs := &fakeObserver{}
+	config := MigratorConfig{}
+	for _, opt := range []MigratorOption{
+		WithTableName("custom_history"),
+		WithSchemaName("tenant_a"),
+		WithDisableCreateTable(),
+		WithLockID(42),
+		WithObserver(obs),
+	} {
+		opt(&config)
+	}
+
+	if config.TableName != "custom_history" {
+		t.Fatalf("TableName = %q, want custom_history", config.TableName)
+	}
+	if config.SchemaName != "tenant_a" {
+		t.Fatalf("SchemaName = %q, want tenant_a", config.SchemaName)
+	}
+	if !config.DisableCreateTable {
+		t.Fatal("DisableCreateTable = false, want true")
+	}
+	if config.LockID != 42 {
+		t.Fatalf("LockID = %d, want 42", config.LockID)
+	}
+	if config.Observer != Observer(obs) {
+		t.Fatal("Observer was not set to the provided observer")
+	}
+}
+
+func TestDeriveLockID_SameInputsAlwaysAgree(t *testing.T) {
+	a := deriveLockID("tenant_a", "migrations_history")
+	b := deriveLockID("tenant_a", "migrations_history")
+	if a != b {
+		t.Fatalf("deriveLockID is not deterministic: %d != %d", a, b)
+	}
+}
+
+func TestDeriveLockID_DistinctSchemaOrTableYieldsDistinctID(t *testing.T) {
+	base := deriveLockID("tenant_a", "migrations_history")
+	if other := deriveLockID("tenant_b", "migrations_history"); other == base {
+		t.Fatal("deriveLockID did not vary with SchemaName")
+	}
+	if other := deriveLockID("tenant_a", "other_history"); other == base {
+		t.Fatal("deriveLockID did not vary with TableName")
+	}
+}
+
+func TestMigrateFromOldSchema_SkipsRawSQLForNonPostgresDrivers(t *testing.T) {
+	// fakeDriver is not a driver.Postgres, so this must return immediately
+	// without ever touching m.db -- which is nil here, so it would panic
+	// if it tried to issue the old_schema query against it.
+	m := newTestMigrator(nil, &fakeDriver{}, &fakeObserver{})
+
+	version, err := m.migrateFromOldSchema(context.Background())
+	if err != nil {
+		t.Fatalf("migrateFromOldSchema: %v", err)
+	}
+	if version != 0 {
+		t.Fatalf("migrateFromOldSchema version = %d, want 0", version)
+	}
+
+	if err := m.migrateToOldSchema(context.Background(), 1); err != nil {
+		t.Fatalf("migrateToOldSchema: %v", err)
+	}
+}
+
+func TestLatestVersion_BrokenChainIsAnError(t *testing.T) {
+	fd := &fakeDriver{history: []driver.HistoryRecord{
+		// version 2's parent (1) was never recorded, e.g. because a row
+		// was inserted into the history table out of band.
+		{Version: 2, Direction: "up", Status: "complete", ParentVersion: 1},
+	}}
+	m := newTestMigrator(nil, fd, &fakeObserver{})
+
+	if _, err := m.LatestVersion(context.Background()); err == nil {
+		t.Fatal("expected LatestVersion to report a broken parent chain, got nil error")
+	}
+}